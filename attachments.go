@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxAttachmentSize rejects any single attached file larger than this, so a
+// stray `@video.mov` doesn't blow past the model's upload limits.
+const maxAttachmentSize = 20 * 1024 * 1024 // 20MB
+
+// Attachment is a file resolved from an `@path` token in a question, ready
+// to hand to a provider as inline binary data.
+type Attachment struct {
+	Path     string
+	MIMEType string
+	Data     []byte
+}
+
+var attachmentTokenRe = regexp.MustCompile(`@(\S+)`)
+
+// extMIMETypes covers the formats this tool actually expects to see
+// (images and PDFs); anything else falls back to content sniffing.
+var extMIMETypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+}
+
+// parseAttachments strips `@path/to/file` tokens out of question, reads each
+// one that actually resolves to a file on disk, and returns the cleaned
+// question text alongside the resolved attachments. A token that doesn't
+// resolve to a file (an email address, an @handle in ordinary prose, ...) is
+// left in the question untouched rather than treated as a failed attachment,
+// since `@` is common in text that was never meant to reference a file. It
+// enforces maxAttachments and maxAttachmentSize.
+func parseAttachments(question string, maxAttachments int) (string, []Attachment, error) {
+	matches := attachmentTokenRe.FindAllStringSubmatch(question, -1)
+	if len(matches) == 0 {
+		return question, nil, nil
+	}
+
+	attachments := make([]Attachment, 0, len(matches))
+	cleaned := question
+
+	for _, m := range matches {
+		token, path := m[0], m[1]
+
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", nil, fmt.Errorf("failed to stat attachment %s: %v", path, err)
+		}
+
+		if len(attachments) >= maxAttachments {
+			return "", nil, fmt.Errorf("question references more than %d attachments", maxAttachments)
+		}
+
+		attachment, err := loadAttachment(path, info)
+		if err != nil {
+			return "", nil, err
+		}
+		attachments = append(attachments, attachment)
+
+		cleaned = strings.Replace(cleaned, token, "", 1)
+	}
+
+	return strings.TrimSpace(cleaned), attachments, nil
+}
+
+func loadAttachment(path string, info os.FileInfo) (Attachment, error) {
+	if info.Size() > maxAttachmentSize {
+		return Attachment{}, fmt.Errorf("attachment %s is %d bytes, exceeding the %d byte limit", path, info.Size(), maxAttachmentSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to read attachment %s: %v", path, err)
+	}
+
+	return Attachment{
+		Path:     path,
+		MIMEType: detectMIMEType(path, data),
+		Data:     data,
+	}, nil
+}
+
+func detectMIMEType(path string, data []byte) string {
+	if mimeType, ok := extMIMETypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return mimeType
+	}
+
+	sniffLen := 512
+	if len(data) < sniffLen {
+		sniffLen = len(data)
+	}
+	return http.DetectContentType(data[:sniffLen])
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// ChatTurn is one provider-agnostic turn of a conversation. Role is either
+// "user" or "assistant"; providers translate it into whatever shape their
+// own history API expects.
+type ChatTurn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatProvider is implemented by providers that can carry conversation
+// history natively (Gemini's StartChat, or a message list prepended to a
+// Groq-style request) and estimate how many tokens that history costs.
+type ChatProvider interface {
+	Provider
+	GenerateWithHistory(ctx context.Context, history []ChatTurn, prompt string) (*Response, error)
+	CountTokens(ctx context.Context, history []ChatTurn, prompt string) (int, error)
+}
+
+// TokenLimiter is implemented by providers that can report their model's
+// context window, such as Gemini's model.Info. Not every ChatProvider
+// supports this, so it's a separate, optionally-asserted interface.
+type TokenLimiter interface {
+	TokenLimits(ctx context.Context) (input, output int32, err error)
+}
+
+// ChatSession holds the running conversation for the REPL: the turn history,
+// the context budget it's trimmed to, and running token totals for /tokens.
+type ChatSession struct {
+	History           []ChatTurn
+	MaxContextTokens  int
+	TotalInputTokens  int
+	TotalOutputTokens int
+}
+
+func NewChatSession(maxContextTokens int) *ChatSession {
+	return &ChatSession{MaxContextTokens: maxContextTokens}
+}
+
+func (s *ChatSession) AddUserTurn(content string) {
+	s.History = append(s.History, ChatTurn{Role: "user", Content: content})
+}
+
+func (s *ChatSession) AddAssistantTurn(content string) {
+	s.History = append(s.History, ChatTurn{Role: "assistant", Content: content})
+}
+
+// Reset clears the conversation and running token totals.
+func (s *ChatSession) Reset() {
+	s.History = nil
+	s.TotalInputTokens = 0
+	s.TotalOutputTokens = 0
+}
+
+// Save writes the session history to path as indented JSON.
+func (s *ChatSession) Save(path string) error {
+	data, err := json.MarshalIndent(s.History, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat history: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write chat history to %s: %v", path, err)
+	}
+	return nil
+}
+
+// Load replaces the session history with the contents of path.
+func (s *ChatSession) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read chat history from %s: %v", path, err)
+	}
+	var history []ChatTurn
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("failed to parse chat history: %v", err)
+	}
+	s.History = history
+	return nil
+}
+
+// Trim drops the oldest turns until counter reports the remaining history
+// fits within MaxContextTokens. counter is whichever ChatProvider the caller
+// trusts to estimate token counts (usually the first one configured).
+func (s *ChatSession) Trim(ctx context.Context, counter ChatProvider) error {
+	if counter == nil || s.MaxContextTokens <= 0 {
+		return nil
+	}
+
+	for len(s.History) > 0 {
+		tokens, err := counter.CountTokens(ctx, s.History, "")
+		if err != nil {
+			return fmt.Errorf("failed to count history tokens: %v", err)
+		}
+		if tokens <= s.MaxContextTokens {
+			break
+		}
+		s.History = s.History[1:]
+	}
+
+	return nil
+}
+
+// firstChatProvider returns the first ChatProvider in the list, used as the
+// canonical token counter and limit source for the REPL.
+func firstChatProvider(providers []Provider) ChatProvider {
+	for _, p := range providers {
+		if cp, ok := p.(ChatProvider); ok {
+			return cp
+		}
+	}
+	return nil
+}
+
+// estimateTokens gives a rough, tokenizer-free token count for providers
+// (like Groq) that don't expose a real counting endpoint.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// toGenaiHistory converts provider-agnostic turns into Gemini's Content
+// history shape, mapping "assistant" onto Gemini's "model" role.
+func toGenaiHistory(history []ChatTurn) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(history))
+	for _, turn := range history {
+		role := "user"
+		if turn.Role == "assistant" {
+			role = "model"
+		}
+		contents = append(contents, &genai.Content{
+			Role:  role,
+			Parts: []genai.Part{genai.Text(turn.Content)},
+		})
+	}
+	return contents
+}
+
+// GenerateWithHistory starts a fresh Gemini chat seeded with history and
+// sends prompt as the next user turn.
+func (p *GeminiProvider) GenerateWithHistory(ctx context.Context, history []ChatTurn, prompt string) (*Response, error) {
+	model := p.client.GenerativeModel(p.model)
+	cs := model.StartChat()
+	cs.History = toGenaiHistory(history)
+
+	resp, err := cs.SendMessage(ctx, genai.Text(prompt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send %s chat message: %v", p.name, err)
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("%s returned no candidates", p.name)
+	}
+
+	return &Response{
+		Source:  p.name,
+		Content: string(resp.Candidates[0].Content.Parts[0].(genai.Text)),
+	}, nil
+}
+
+// CountTokens asks Gemini how many tokens history plus an optional pending
+// prompt would cost, in a single CountTokens call: token counts aren't
+// additive across separate calls, so every Content's parts are flattened
+// into one slice first.
+func (p *GeminiProvider) CountTokens(ctx context.Context, history []ChatTurn, prompt string) (int, error) {
+	model := p.client.GenerativeModel(p.model)
+	contents := toGenaiHistory(history)
+	if prompt != "" {
+		contents = append(contents, &genai.Content{Role: "user", Parts: []genai.Part{genai.Text(prompt)}})
+	}
+	if len(contents) == 0 {
+		return 0, nil
+	}
+
+	var parts []genai.Part
+	for _, c := range contents {
+		parts = append(parts, c.Parts...)
+	}
+
+	resp, err := model.CountTokens(ctx, parts...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s tokens: %v", p.name, err)
+	}
+	return int(resp.TotalTokens), nil
+}
+
+// TokenLimits reports Gemini's input/output token limits for display at
+// startup.
+func (p *GeminiProvider) TokenLimits(ctx context.Context) (input, output int32, err error) {
+	model := p.client.GenerativeModel(p.model)
+	info, err := model.Info(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch %s model info: %v", p.name, err)
+	}
+	return info.InputTokenLimit, info.OutputTokenLimit, nil
+}
+
+// historyToMessages converts provider-agnostic turns into Groq's OpenAI-style
+// message list, mapping "assistant" onto the "assistant" role directly.
+func historyToMessages(history []ChatTurn) []Message {
+	messages := make([]Message, 0, len(history))
+	for _, turn := range history {
+		messages = append(messages, Message{Role: turn.Role, Content: turn.Content})
+	}
+	return messages
+}
+
+// GenerateWithHistory prepends history to the Groq request's message list
+// before sending the new prompt.
+func (p *GroqProvider) GenerateWithHistory(ctx context.Context, history []ChatTurn, prompt string) (*Response, error) {
+	messages := append(historyToMessages(history), Message{Role: "user", Content: prompt})
+	return p.generateMessages(ctx, messages)
+}
+
+// CountTokens estimates token usage with a simple length-based heuristic
+// since Groq's API doesn't expose a counting endpoint.
+func (p *GroqProvider) CountTokens(ctx context.Context, history []ChatTurn, prompt string) (int, error) {
+	total := estimateTokens(prompt)
+	for _, turn := range history {
+		total += estimateTokens(turn.Content)
+	}
+	return total, nil
+}
+
+// fanOutChat is fanOut's chat-aware counterpart: ChatProvider members get the
+// running history natively, everyone else falls back to a bare Generate. The
+// history is copied up front since goroutines below run concurrently with
+// whatever the REPL does with session once this call returns.
+func fanOutChat(ctx context.Context, providers []Provider, session *ChatSession, prompt string) []providerResult {
+	history := make([]ChatTurn, len(session.History))
+	copy(history, session.History)
+
+	results := make([]providerResult, len(providers))
+	var wg sync.WaitGroup
+
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			if cp, ok := p.(ChatProvider); ok {
+				resp, err := cp.GenerateWithHistory(ctx, history, prompt)
+				results[i] = providerResult{provider: p, response: resp, err: err}
+				return
+			}
+			resp, err := p.Generate(ctx, prompt)
+			results[i] = providerResult{provider: p, response: resp, err: err}
+		}(i, p)
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProviderSpec describes one ensemble member as loaded from the YAML config.
+type ProviderSpec struct {
+	Name      string  `yaml:"name"`
+	Type      string  `yaml:"type"` // "gemini", "groq", or "openai-compatible"
+	Weight    float64 `yaml:"weight"`
+	Model     string  `yaml:"model,omitempty"`
+	BaseURL   string  `yaml:"base_url,omitempty"`    // only used by "openai-compatible"
+	APIKeyEnv string  `yaml:"api_key_env,omitempty"` // env var holding the bearer token for "openai-compatible"; unset means no Authorization header
+}
+
+// EnsembleConfig is the top-level shape of ensemble.yaml.
+type EnsembleConfig struct {
+	Providers []ProviderSpec `yaml:"providers"`
+	// Judge names the provider to fall back on when the vote has no majority.
+	Judge string `yaml:"judge"`
+}
+
+// usesProviderType reports whether any configured provider is of the given
+// type, so callers can skip requirements (like an API key) for provider
+// types the config doesn't actually use.
+func (cfg *EnsembleConfig) usesProviderType(t string) bool {
+	for _, spec := range cfg.Providers {
+		if spec.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultEnsembleConfig mirrors the tool's original hardcoded Gemini+Groq
+// pairing, used when no ensemble.yaml is present.
+func defaultEnsembleConfig() *EnsembleConfig {
+	return &EnsembleConfig{
+		Providers: []ProviderSpec{
+			{Name: "Gemini", Type: "gemini", Weight: 1.0},
+			{Name: "Groq", Type: "groq", Weight: 1.0},
+		},
+		Judge: "Gemini",
+	}
+}
+
+// loadEnsembleConfig reads and parses the ensemble config at path. A missing
+// file is not an error: callers get the default two-provider setup instead.
+func loadEnsembleConfig(path string) (*EnsembleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return defaultEnsembleConfig(), nil
+		}
+		return nil, fmt.Errorf("failed to read ensemble config: %v", err)
+	}
+
+	var cfg EnsembleConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse ensemble config: %v", err)
+	}
+
+	if len(cfg.Providers) == 0 {
+		return nil, fmt.Errorf("ensemble config at %s defines no providers", path)
+	}
+	if cfg.Judge == "" {
+		cfg.Judge = cfg.Providers[0].Name
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// EmbeddingCache persists response embeddings to disk keyed by the SHA256 of
+// the text they were computed from, so retries and repeated comparisons
+// don't re-embed (and re-bill) the same content. mu guards vectors, since the
+// `serve` gateway can run several comparisons concurrently across requests.
+type EmbeddingCache struct {
+	path    string
+	mu      sync.RWMutex
+	vectors map[string][]float32
+}
+
+// LoadEmbeddingCache reads path if it exists, or starts an empty cache if it
+// doesn't.
+func LoadEmbeddingCache(path string) (*EmbeddingCache, error) {
+	cache := &EmbeddingCache{path: path, vectors: make(map[string][]float32)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("failed to read embedding cache: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &cache.vectors); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding cache: %v", err)
+	}
+	return cache, nil
+}
+
+// Save writes the cache back to its path as JSON.
+func (c *EmbeddingCache) Save() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	data, err := json.MarshalIndent(c.vectors, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding cache: %v", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write embedding cache: %v", err)
+	}
+	return nil
+}
+
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *EmbeddingCache) get(text string) ([]float32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.vectors[textHash(text)]
+	return v, ok
+}
+
+func (c *EmbeddingCache) put(text string, vector []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.vectors[textHash(text)] = vector
+}
+
+// cosineSimilarity returns the cosine similarity of two equal-length vectors
+// in [-1, 1], or 0 if either vector is empty.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(b) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// EmbeddingComparator decides whether two responses are semantically
+// equivalent using Gemini embeddings, caching each text's embedding and
+// only falling back to an LLM judge when the similarity score falls in an
+// ambiguous band between "clearly different" and "clearly the same".
+type EmbeddingComparator struct {
+	client       *genai.Client
+	cache        *EmbeddingCache
+	threshold    float64 // similarity >= threshold: treated as equivalent
+	ambiguousLow float64 // similarity <= ambiguousLow: treated as different
+}
+
+// NewEmbeddingComparator builds a comparator backed by its own Gemini client.
+func NewEmbeddingComparator(ctx context.Context, apiKey string, cache *EmbeddingCache, threshold, ambiguousLow float64) (*EmbeddingComparator, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client for embeddings: %v", err)
+	}
+	return &EmbeddingComparator{client: client, cache: cache, threshold: threshold, ambiguousLow: ambiguousLow}, nil
+}
+
+func (c *EmbeddingComparator) Close() error {
+	return c.client.Close()
+}
+
+func (c *EmbeddingComparator) embed(ctx context.Context, text string) ([]float32, error) {
+	if vec, ok := c.cache.get(text); ok {
+		return vec, nil
+	}
+
+	em := c.client.EmbeddingModel("embedding-001")
+	resp, err := em.EmbedContent(ctx, genai.Text(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed text: %v", err)
+	}
+
+	vec := resp.Embedding.Values
+	c.cache.put(text, vec)
+	return vec, nil
+}
+
+// compareResponses reports whether resp1 and resp2 are semantically
+// equivalent: embeddings above the configured threshold are treated as a
+// match, embeddings at or below the ambiguous floor are treated as distinct,
+// and anything in between is resolved by asking Gemini directly, matching
+// the tool's original LLM-as-judge behavior for just that narrow band.
+func (c *EmbeddingComparator) compareResponses(ctx context.Context, resp1, resp2 string) (bool, error) {
+	emb1, err := c.embed(ctx, resp1)
+	if err != nil {
+		return false, err
+	}
+	emb2, err := c.embed(ctx, resp2)
+	if err != nil {
+		return false, err
+	}
+
+	similarity := cosineSimilarity(emb1, emb2)
+
+	switch {
+	case similarity >= c.threshold:
+		return true, nil
+	case similarity <= c.ambiguousLow:
+		return false, nil
+	default:
+		return judgeSimilarity(ctx, c.client, resp1, resp2)
+	}
+}
+
+// judgeSimilarity is the original LLM-as-judge comparison, now only used to
+// break ties in the ambiguous similarity band.
+func judgeSimilarity(ctx context.Context, client *genai.Client, resp1, resp2 string) (bool, error) {
+	comparisonPrompt := fmt.Sprintf(`Compare these two responses and determine if they convey the same meaning.
+	Only respond with "true" if they are semantically equivalent, or "false" if they differ significantly in meaning.
+
+	Response 1:
+	%s
+
+	Response 2:
+	%s`, resp1, resp2)
+
+	model := client.GenerativeModel("gemini-pro")
+	resp, err := model.GenerateContent(ctx, genai.Text(comparisonPrompt))
+	if err != nil {
+		return false, fmt.Errorf("failed to judge response similarity: %v", err)
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return false, fmt.Errorf("judge returned no candidates")
+	}
+
+	result := strings.ToLower(strings.TrimSpace(string(resp.Candidates[0].Content.Parts[0].(genai.Text))))
+	return result == "true", nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// buildProviders turns the parsed ensemble config into live Provider values.
+func buildProviders(ctx context.Context, cfg *EnsembleConfig, appCfg Config) ([]Provider, error) {
+	providers := make([]Provider, 0, len(cfg.Providers))
+
+	for _, spec := range cfg.Providers {
+		switch spec.Type {
+		case "gemini":
+			p, err := NewGeminiProvider(ctx, spec.Name, appCfg.GeminiKey, spec.Model, spec.Weight)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build provider %q: %v", spec.Name, err)
+			}
+			providers = append(providers, p)
+		case "groq":
+			providers = append(providers, NewGroqProvider(spec.Name, appCfg.GroqKey, spec.Model, spec.Weight))
+		case "openai-compatible":
+			if spec.BaseURL == "" {
+				return nil, fmt.Errorf("provider %q is openai-compatible but has no base_url", spec.Name)
+			}
+			var apiKey string
+			if spec.APIKeyEnv != "" {
+				apiKey = os.Getenv(spec.APIKeyEnv)
+			}
+			providers = append(providers, NewOpenAICompatProvider(spec.Name, spec.BaseURL, apiKey, spec.Model, spec.Weight))
+		default:
+			return nil, fmt.Errorf("unknown provider type %q for %q", spec.Type, spec.Name)
+		}
+	}
+
+	return providers, nil
+}
+
+// closeProviders closes every provider, logging but not failing on errors
+// from any individual one.
+func closeProviders(providers []Provider) {
+	for _, p := range providers {
+		if err := p.Close(); err != nil {
+			fmt.Printf("warning: failed to close provider %s: %v\n", p.Name(), err)
+		}
+	}
+}
+
+// providerResult pairs a provider's response with the weight it votes with.
+type providerResult struct {
+	provider Provider
+	response *Response
+	err      error
+}
+
+// fanOut calls Generate on every provider concurrently and collects every
+// result, including errors, in provider order.
+func fanOut(ctx context.Context, providers []Provider, prompt string) []providerResult {
+	results := make([]providerResult, len(providers))
+	var wg sync.WaitGroup
+
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			resp, err := p.Generate(ctx, prompt)
+			results[i] = providerResult{provider: p, response: resp, err: err}
+		}(i, p)
+	}
+
+	wg.Wait()
+	return results
+}
+
+var optionAnswerRe = regexp.MustCompile(`(?i)option\s+([A-Za-z0-9]+)\s*:?\s*(Yes|No)`)
+
+// extractMCQAnswers pulls "Option X: Yes/No" tokens out of a response and
+// normalizes them into a stable signature like "A=Yes,B=No,C=Yes" so two
+// responses that agree on substance but differ in prose still compare equal.
+func extractMCQAnswers(content string) string {
+	matches := optionAnswerRe.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(matches))
+	for _, m := range matches {
+		option := strings.ToUpper(strings.TrimSpace(m[1]))
+		answer := strings.Title(strings.ToLower(strings.TrimSpace(m[2])))
+		parts = append(parts, fmt.Sprintf("%s=%s", option, answer))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// ensembleVote tallies weighted votes over each provider's normalized MCQ
+// signature and returns the winning response along with whether it holds a
+// strict majority of the total weight.
+func ensembleVote(results []providerResult) (winner *Response, majority bool) {
+	type tally struct {
+		weight   float64
+		response *Response
+	}
+
+	totalWeight := 0.0
+	tallies := make(map[string]*tally)
+
+	for _, r := range results {
+		if r.err != nil || r.response == nil {
+			continue
+		}
+
+		weight := providerWeight(r.provider)
+		totalWeight += weight
+
+		signature := extractMCQAnswers(r.response.Content)
+		if signature == "" {
+			// Not a parseable MCQ response; it can't anchor a vote but its
+			// weight still counts toward the majority denominator below.
+			continue
+		}
+
+		t, ok := tallies[signature]
+		if !ok {
+			t = &tally{response: r.response}
+			tallies[signature] = t
+		}
+		t.weight += weight
+	}
+
+	var best *tally
+	for _, t := range tallies {
+		if best == nil || t.weight > best.weight {
+			best = t
+		}
+	}
+
+	if best == nil || totalWeight == 0 {
+		return nil, false
+	}
+
+	return best.response, best.weight > totalWeight/2
+}
+
+// ensembleVoteSemantic handles free-text questions where no response parses
+// as an MCQ answer, so extractMCQAnswers can't anchor a vote. It clusters
+// responses by embedding similarity via comparator instead of exact-text
+// grouping, then applies the same weighted-majority rule as ensembleVote.
+func ensembleVoteSemantic(ctx context.Context, results []providerResult, comparator *EmbeddingComparator) (winner *Response, majority bool, err error) {
+	type cluster struct {
+		weight         float64
+		representative *Response
+	}
+
+	var clusters []*cluster
+	totalWeight := 0.0
+
+	for _, r := range results {
+		if r.err != nil || r.response == nil {
+			continue
+		}
+
+		weight := providerWeight(r.provider)
+		totalWeight += weight
+
+		var matched *cluster
+		for _, c := range clusters {
+			same, err := comparator.compareResponses(ctx, c.representative.Content, r.response.Content)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to compare responses: %v", err)
+			}
+			if same {
+				matched = c
+				break
+			}
+		}
+
+		if matched == nil {
+			matched = &cluster{representative: r.response}
+			clusters = append(clusters, matched)
+		}
+		matched.weight += weight
+	}
+
+	var best *cluster
+	for _, c := range clusters {
+		if best == nil || c.weight > best.weight {
+			best = c
+		}
+	}
+
+	if best == nil || totalWeight == 0 {
+		return nil, false, nil
+	}
+
+	return best.representative, best.weight > totalWeight/2, nil
+}
+
+// judgeFallback is called when no response signature commands a majority. It
+// asks the configured judge provider to pick the single best answer from the
+// full set of responses.
+func judgeFallback(ctx context.Context, providers []Provider, judgeName string, question string, results []providerResult) (*Response, error) {
+	var judge Provider
+	for _, p := range providers {
+		if p.Name() == judgeName {
+			judge = p
+			break
+		}
+	}
+	if judge == nil {
+		return nil, fmt.Errorf("judge provider %q not found among ensemble members", judgeName)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Multiple AI models answered the same question and disagree. ")
+	sb.WriteString("Read their responses below and reply with only the single best answer, ")
+	sb.WriteString("reproducing its full content verbatim.\n\n")
+	fmt.Fprintf(&sb, "Question:\n%s\n\n", question)
+
+	for _, r := range results {
+		if r.err != nil || r.response == nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s's response:\n%s\n\n", r.provider.Name(), r.response.Content)
+	}
+
+	resp, err := judge.Generate(ctx, sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("judge fallback failed: %v", err)
+	}
+	resp.Source = fmt.Sprintf("%s (judge)", judge.Name())
+	return resp, nil
+}
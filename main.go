@@ -2,21 +2,16 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 
-	"github.com/google/generative-ai-go/genai"
 	"github.com/joho/godotenv"
-	"google.golang.org/api/option"
 )
 
 type Config struct {
@@ -34,6 +29,7 @@ type Response struct {
 type GroqRequest struct {
 	Model    string    `json:"model"`
 	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream,omitempty"`
 }
 
 type Message struct {
@@ -49,6 +45,74 @@ type GroqResponse struct {
 	} `json:"choices"`
 }
 
+// runtime bundles everything both the REPL and `serve` entrypoints need to
+// answer a question: the shared config, the live ensemble, and the
+// embedding comparator.
+type runtime struct {
+	config      Config
+	providers   []Provider
+	ensembleCfg *EnsembleConfig
+	comparator  *EmbeddingComparator
+}
+
+// setupRuntime builds a runtime from the shared set of flags common to both
+// entrypoints, returning a cleanup func that closes providers, the embedding
+// comparator, and flushes its cache.
+func setupRuntime(ctx context.Context, geminiKey, groqKey, ensemblePath string, maxRetries int, similarityThreshold, ambiguousThreshold float64, embeddingCachePath string) (*runtime, func(), error) {
+	// Gemini is always required: beyond any "gemini" ensemble member, the
+	// embedding comparator is a Gemini client regardless of which providers
+	// are configured. Groq is only required if the ensemble actually names a
+	// "groq" provider, so a Gemini + local openai-compatible pairing doesn't
+	// need a Groq key at all.
+	if geminiKey == "" {
+		return nil, nil, fmt.Errorf("please set GEMINI_API_KEY in .env file")
+	}
+
+	ensembleCfg, err := loadEnsembleConfig(ensemblePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load ensemble config: %v", err)
+	}
+
+	if groqKey == "" && ensembleCfg.usesProviderType("groq") {
+		return nil, nil, fmt.Errorf("please set GROQ_API_KEY in .env file: ensemble config at %s includes a groq provider", ensemblePath)
+	}
+
+	config := Config{
+		GeminiKey:  geminiKey,
+		GroqKey:    groqKey,
+		MaxRetries: maxRetries,
+	}
+
+	providers, err := buildProviders(ctx, ensembleCfg, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build ensemble providers: %v", err)
+	}
+
+	embeddingCache, err := LoadEmbeddingCache(embeddingCachePath)
+	if err != nil {
+		closeProviders(providers)
+		return nil, nil, fmt.Errorf("failed to load embedding cache: %v", err)
+	}
+
+	comparator, err := NewEmbeddingComparator(ctx, config.GeminiKey, embeddingCache, similarityThreshold, ambiguousThreshold)
+	if err != nil {
+		closeProviders(providers)
+		return nil, nil, fmt.Errorf("failed to create embedding comparator: %v", err)
+	}
+
+	cleanup := func() {
+		if err := comparator.Close(); err != nil {
+			log.Printf("Failed to close embedding comparator: %v", err)
+		}
+		if err := embeddingCache.Save(); err != nil {
+			log.Printf("Failed to save embedding cache: %v", err)
+		}
+		closeProviders(providers)
+	}
+
+	return &runtime{config: config, providers: providers, ensembleCfg: ensembleCfg, comparator: comparator}, cleanup, nil
+}
+
 func main() {
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
@@ -74,18 +138,41 @@ func main() {
 	geminiKey := os.Getenv("GEMINI_API_KEY")
 	groqKey := os.Getenv("GROQ_API_KEY")
 
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(ctx, geminiKey, groqKey, os.Args[2:])
+		return
+	}
+
 	// Parse command line flags
 	maxRetries := flag.Int("max-retries", 3, "Maximum number of retry attempts")
+	ensemblePath := flag.String("ensemble-config", "ensemble.yaml", "Path to the ensemble providers config")
+	stream := flag.Bool("stream", false, "Print provider tokens as they arrive instead of waiting for full responses")
+	contextBudget := flag.Int("context-budget", 30000, "Maximum tokens of chat history to keep before trimming oldest turns")
+	similarityThreshold := flag.Float64("similarity-threshold", 0.85, "Cosine similarity above which two responses are considered equivalent")
+	ambiguousThreshold := flag.Float64("ambiguous-threshold", 0.70, "Cosine similarity below which two responses are considered different; between this and similarity-threshold, an LLM judge decides")
+	embeddingCachePath := flag.String("embedding-cache", "embedding-cache.json", "Path to the on-disk embedding cache")
+	maxAttachments := flag.Int("max-attachments", 5, "Maximum number of @file attachments allowed per question")
 	flag.Parse()
 
-	if geminiKey == "" || groqKey == "" {
-		log.Fatal("Please set GEMINI_API_KEY and GROQ_API_KEY in .env file")
+	rt, cleanup, err := setupRuntime(ctx, geminiKey, groqKey, *ensemblePath, *maxRetries, *similarityThreshold, *ambiguousThreshold, *embeddingCachePath)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	config := Config{
-		GeminiKey:  geminiKey,
-		GroqKey:    groqKey,
-		MaxRetries: *maxRetries,
+	defer cleanup()
+
+	config := rt.config
+	providers := rt.providers
+	ensembleCfg := rt.ensembleCfg
+	comparator := rt.comparator
+
+	session := NewChatSession(*contextBudget)
+	counter := firstChatProvider(providers)
+	if limiter, ok := counter.(TokenLimiter); ok {
+		if input, output, err := limiter.TokenLimits(ctx); err != nil {
+			log.Printf("Failed to fetch token limits: %v", err)
+		} else {
+			fmt.Printf("Model token limits: %d input / %d output\n", input, output)
+		}
 	}
 
 	reader := bufio.NewReader(os.Stdin)
@@ -93,6 +180,7 @@ func main() {
 	fmt.Println("Interactive AI Question Answering System")
 	fmt.Println("Enter your questions (type 'exit' to quit)")
 	fmt.Println("Type your question and press Ctrl+D (Unix) or Ctrl+Z (Windows) on a new line to finish")
+	fmt.Println("Slash commands: /reset, /save <file>, /load <file>, /tokens")
 	fmt.Println("----------------------------------------")
 
 	for {
@@ -123,12 +211,28 @@ func main() {
 			continue
 		}
 
-		response, err := processQuestion(ctx, question, config)
+		if handleSlashCommand(session, question) {
+			reader = bufio.NewReader(os.Stdin)
+			continue
+		}
+
+		if counter != nil {
+			if err := session.Trim(ctx, counter); err != nil {
+				log.Printf("Failed to trim chat history: %v", err)
+			}
+		}
+
+		response, err := processQuestion(ctx, question, config, providers, ensembleCfg, *stream, session, comparator, *maxAttachments)
 		if err != nil {
 			log.Printf("Error processing question: %v", err)
 			continue
 		}
 
+		session.AddUserTurn(question)
+		session.AddAssistantTurn(response)
+		session.TotalInputTokens += estimateTokens(question)
+		session.TotalOutputTokens += estimateTokens(response)
+
 		fmt.Printf("\nResponse:\n%s\n", response)
 
 		// Clear the input buffer
@@ -136,96 +240,119 @@ func main() {
 	}
 }
 
-func processQuestion(ctx context.Context, question string, config Config) (string, error) {
-	var geminiResp, groqResp *Response
-	var err error
-	var lastGeminiErr, lastGroqErr error
+// handleSlashCommand recognizes /reset, /save, /load, and /tokens; it
+// returns true if input was a slash command (handled or not) so the caller
+// skips sending it to the providers.
+func handleSlashCommand(session *ChatSession, input string) bool {
+	if !strings.HasPrefix(input, "/") {
+		return false
+	}
 
-	for attempt := 0; attempt < config.MaxRetries; attempt++ {
-		// Get responses from both APIs
-		geminiResp, err = getGeminiResponse(ctx, question, config.GeminiKey)
-		if err != nil {
-			log.Printf("Attempt %d: Gemini API error: %v", attempt+1, err)
-			lastGeminiErr = err
-			continue
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case "/reset":
+		session.Reset()
+		fmt.Println("Chat history cleared.")
+	case "/save":
+		if len(fields) != 2 {
+			fmt.Println("Usage: /save <file>")
+			break
 		}
-
-		groqResp, err = getGroqResponse(question, config.GroqKey)
-		if err != nil {
-			log.Printf("Attempt %d: Groq API error: %v", attempt+1, err)
-			lastGroqErr = err
-			continue
+		if err := session.Save(fields[1]); err != nil {
+			fmt.Printf("Failed to save chat history: %v\n", err)
+		} else {
+			fmt.Printf("Chat history saved to %s\n", fields[1])
 		}
-
-		// Compare responses using Gemini
-		similar, err := compareResponses(ctx, geminiResp.Content, groqResp.Content, config.GeminiKey)
-		if err != nil {
-			log.Printf("Attempt %d: Comparison error: %v", attempt+1, err)
-			continue
+	case "/load":
+		if len(fields) != 2 {
+			fmt.Println("Usage: /load <file>")
+			break
 		}
-
-		if similar {
-			return geminiResp.Content, nil
+		if err := session.Load(fields[1]); err != nil {
+			fmt.Printf("Failed to load chat history: %v\n", err)
+		} else {
+			fmt.Printf("Chat history loaded from %s\n", fields[1])
 		}
-
-		log.Printf("Attempt %d: Responses differ, retrying...", attempt+1)
+	case "/tokens":
+		fmt.Printf("Input tokens: %d\nOutput tokens: %d\nHistory turns: %d\n",
+			session.TotalInputTokens, session.TotalOutputTokens, len(session.History))
+	default:
+		fmt.Printf("Unknown command: %s\n", fields[0])
 	}
 
-	// If we've exhausted retries, return error message
-	if geminiResp == nil && groqResp == nil {
-		return "", fmt.Errorf("failed to get responses after %d attempts. Gemini error: %v, Groq error: %v",
-			config.MaxRetries, lastGeminiErr, lastGroqErr)
+	return true
+}
+
+// processQuestion fans the question out to every configured provider,
+// settles on an answer via weighted majority vote, and retries the whole
+// ensemble when the vote doesn't converge before falling back to a judge.
+// maxAttachments <= 0 disables @file attachment parsing entirely (rather
+// than enforcing a limit of zero), for callers like the `serve` gateway
+// where an `@` in ordinary text can't be told apart from an intentional
+// attachment token.
+func processQuestion(ctx context.Context, question string, config Config, providers []Provider, ensembleCfg *EnsembleConfig, stream bool, session *ChatSession, comparator *EmbeddingComparator, maxAttachments int) (string, error) {
+	var attachments []Attachment
+	if maxAttachments > 0 {
+		var err error
+		question, attachments, err = parseAttachments(question, maxAttachments)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	// Return both responses if available
-	geminiContent := "Error getting response"
-	groqContent := "Error getting response"
+	enhancedPrompt := buildMCQPrompt(question)
 
-	if geminiResp != nil {
-		geminiContent = formatResponse(geminiResp.Content)
-	}
-	if groqResp != nil {
-		groqContent = formatResponse(groqResp.Content)
-	}
+	var lastResults []providerResult
 
-	return fmt.Sprintf("Responses after %d attempts:\n\nGemini Response:\n%s\n\nGroq Response:\n%s",
-		config.MaxRetries, geminiContent, groqContent), nil
-}
+	for attempt := 0; attempt < config.MaxRetries; attempt++ {
+		var results []providerResult
+		switch {
+		case len(attachments) > 0:
+			results = fanOutMultimodal(ctx, providers, enhancedPrompt, attachments)
+		case stream && session != nil && len(session.History) > 0:
+			results = fanOutChatStream(ctx, providers, session, enhancedPrompt)
+		case session != nil && len(session.History) > 0:
+			results = fanOutChat(ctx, providers, session, enhancedPrompt)
+		case stream:
+			results = fanOutStream(ctx, providers, enhancedPrompt)
+		default:
+			results = fanOut(ctx, providers, enhancedPrompt)
+		}
+		lastResults = results
 
-func getGeminiResponse(ctx context.Context, question, apiKey string) (*Response, error) {
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
-	}
-	defer client.Close()
+		winner, majority := ensembleVote(results)
+		if winner == nil && comparator != nil {
+			semanticWinner, semanticMajority, err := ensembleVoteSemantic(ctx, results, comparator)
+			if err != nil {
+				log.Printf("Attempt %d: semantic vote failed: %v", attempt+1, err)
+			} else {
+				winner, majority = semanticWinner, semanticMajority
+			}
+		}
 
-	// Enhance the prompt for multiple choice questions
-	enhancedPrompt := fmt.Sprintf(`If this is a multiple choice question, please:
-1. Analyze each option carefully
-2. Provide a clear "Yes" or "No" for each option
-3. Explain the reasoning for each option
-4. At the end, summarize which options are correct
+		if majority {
+			return winner.Content, nil
+		}
 
-Here's the question:
-%s`, question)
+		if winner != nil {
+			judged, err := judgeFallback(ctx, providers, ensembleCfg.Judge, question, results)
+			if err != nil {
+				log.Printf("Attempt %d: judge fallback failed: %v", attempt+1, err)
+			} else {
+				return judged.Content, nil
+			}
+		}
 
-	model := client.GenerativeModel("gemini-pro")
-	resp, err := model.GenerateContent(ctx, genai.Text(enhancedPrompt))
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate Gemini response: %v", err)
+		log.Printf("Attempt %d: no ensemble majority, retrying...", attempt+1)
 	}
 
-	return &Response{
-		Source:  "Gemini",
-		Content: string(resp.Candidates[0].Content.Parts[0].(genai.Text)),
-	}, nil
+	return formatEnsembleResults(config.MaxRetries, lastResults), nil
 }
 
-func getGroqResponse(question, apiKey string) (*Response, error) {
-	url := "https://api.groq.com/openai/v1/chat/completions"
-
-	// Enhance the prompt for multiple choice questions
-	enhancedPrompt := fmt.Sprintf(`If this is a multiple choice question, please:
+// buildMCQPrompt wraps a raw question with instructions that make MCQ
+// answers easy for extractMCQAnswers to parse back out.
+func buildMCQPrompt(question string) string {
+	return fmt.Sprintf(`If this is a multiple choice question, please:
 1. Analyze each option carefully
 2. Provide a clear "Yes" or "No" for each option
 3. Explain the reasoning for each option
@@ -233,80 +360,23 @@ func getGroqResponse(question, apiKey string) (*Response, error) {
 
 Here's the question:
 %s`, question)
-
-	reqBody := GroqRequest{
-		Model: "llama-3.3-70b-versatile",
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: enhancedPrompt,
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
-	}
-
-	var groqResp GroqResponse
-	if err := json.NewDecoder(resp.Body).Decode(&groqResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
-	}
-
-	if len(groqResp.Choices) == 0 {
-		return nil, fmt.Errorf("no response choices returned")
-	}
-
-	return &Response{
-		Source:  "Groq",
-		Content: groqResp.Choices[0].Message.Content,
-	}, nil
 }
 
-func compareResponses(ctx context.Context, resp1, resp2, geminiKey string) (bool, error) {
-	client, err := genai.NewClient(ctx, option.WithAPIKey(geminiKey))
-	if err != nil {
-		return false, fmt.Errorf("failed to create Gemini client for comparison: %v", err)
-	}
-	defer client.Close()
-
-	comparisonPrompt := fmt.Sprintf(`Compare these two responses and determine if they convey the same meaning. 
-	Only respond with "true" if they are semantically equivalent, or "false" if they differ significantly in meaning.
-	
-	Response 1:
-	%s
-
-	Response 2:
-	%s`, resp1, resp2)
+// formatEnsembleResults renders every provider's outcome (success or error)
+// once the retry budget is exhausted without a confident answer.
+func formatEnsembleResults(attempts int, results []providerResult) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Responses after %d attempts:\n", attempts)
 
-	model := client.GenerativeModel("gemini-pro")
-	resp, err := model.GenerateContent(ctx, genai.Text(comparisonPrompt))
-	if err != nil {
-		return false, fmt.Errorf("failed to compare responses using Gemini: %v", err)
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(&sb, "\n%s Response:\nError getting response: %v\n", r.provider.Name(), r.err)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s Response:\n%s\n", r.provider.Name(), formatResponse(r.response.Content))
 	}
 
-	result := strings.ToLower(strings.TrimSpace(string(resp.Candidates[0].Content.Parts[0].(genai.Text))))
-	return result == "true", nil
+	return sb.String()
 }
 
 func formatResponse(response string) string {
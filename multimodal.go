@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// geminiVisionModel is used instead of a provider's configured text model
+// whenever a question carries attachments, matching the model switch Gemini
+// recommends for multimodal prompts.
+const geminiVisionModel = "gemini-1.5-flash"
+
+// MultimodalProvider is implemented by providers that can accept binary
+// attachments (images, PDFs) alongside a text prompt. Providers that don't
+// implement it abstain from questions that carry attachments.
+type MultimodalProvider interface {
+	Provider
+	GenerateWithAttachments(ctx context.Context, prompt string, attachments []Attachment) (*Response, error)
+}
+
+// GenerateWithAttachments sends the prompt and every attachment as a
+// genai.Blob part to Gemini's vision-capable model.
+func (p *GeminiProvider) GenerateWithAttachments(ctx context.Context, prompt string, attachments []Attachment) (*Response, error) {
+	model := p.client.GenerativeModel(geminiVisionModel)
+
+	parts := make([]genai.Part, 0, len(attachments)+1)
+	parts = append(parts, genai.Text(prompt))
+	for _, a := range attachments {
+		parts = append(parts, genai.Blob{MIMEType: a.MIMEType, Data: a.Data})
+	}
+
+	resp, err := model.GenerateContent(ctx, parts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s response: %v", p.name, err)
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("%s returned no candidates", p.name)
+	}
+
+	return &Response{
+		Source:  p.name,
+		Content: string(resp.Candidates[0].Content.Parts[0].(genai.Text)),
+	}, nil
+}
+
+// openAIVisionMessage mirrors the OpenAI chat completions multi-part content
+// shape used to attach images: a list of {type, text} and
+// {type, image_url: {url}} parts instead of a plain string.
+type openAIVisionMessage struct {
+	Role    string                `json:"role"`
+	Content []openAIVisionContent `json:"content"`
+}
+
+type openAIVisionContent struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *openAIImgURL `json:"image_url,omitempty"`
+}
+
+type openAIImgURL struct {
+	URL string `json:"url"`
+}
+
+// GenerateWithAttachments encodes each attachment as a data: URL and sends
+// it as an image_url content part, for OpenAI-compatible endpoints (LocalAI,
+// Ollama, ...) that support vision.
+func (p *OpenAICompatProvider) GenerateWithAttachments(ctx context.Context, prompt string, attachments []Attachment) (*Response, error) {
+	content := make([]openAIVisionContent, 0, len(attachments)+1)
+	content = append(content, openAIVisionContent{Type: "text", Text: prompt})
+	for _, a := range attachments {
+		dataURL := fmt.Sprintf("data:%s;base64,%s", a.MIMEType, base64.StdEncoding.EncodeToString(a.Data))
+		content = append(content, openAIVisionContent{Type: "image_url", ImageURL: &openAIImgURL{URL: dataURL}})
+	}
+
+	return p.generateVisionMessages(ctx, []openAIVisionMessage{{Role: "user", Content: content}})
+}
+
+// openAIVisionRequest is GroqRequest's shape with multi-part message content
+// instead of plain strings, needed only for vision requests.
+type openAIVisionRequest struct {
+	Model    string                `json:"model"`
+	Messages []openAIVisionMessage `json:"messages"`
+}
+
+func (p *OpenAICompatProvider) generateVisionMessages(ctx context.Context, messages []openAIVisionMessage) (*Response, error) {
+	reqBody := openAIVisionRequest{
+		Model:    p.model,
+		Messages: messages,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+	}
+
+	var compatResp GroqResponse
+	if err := json.NewDecoder(resp.Body).Decode(&compatResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	if len(compatResp.Choices) == 0 {
+		return nil, fmt.Errorf("no response choices returned")
+	}
+
+	return &Response{
+		Source:  p.name,
+		Content: compatResp.Choices[0].Message.Content,
+	}, nil
+}
+
+// fanOutMultimodal calls GenerateWithAttachments on providers that support
+// it and abstains (records an error, excluding the provider from the vote)
+// on the ones that don't.
+func fanOutMultimodal(ctx context.Context, providers []Provider, prompt string, attachments []Attachment) []providerResult {
+	results := make([]providerResult, len(providers))
+	done := make(chan struct{}, len(providers))
+
+	for i, p := range providers {
+		go func(i int, p Provider) {
+			defer func() { done <- struct{}{} }()
+
+			mp, ok := p.(MultimodalProvider)
+			if !ok {
+				results[i] = providerResult{provider: p, err: fmt.Errorf("%s does not support attachments; abstaining", p.Name())}
+				return
+			}
+
+			resp, err := mp.GenerateWithAttachments(ctx, prompt, attachments)
+			results[i] = providerResult{provider: p, response: resp, err: err}
+		}(i, p)
+	}
+
+	for range providers {
+		<-done
+	}
+	return results
+}
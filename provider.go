@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// Provider is implemented by anything that can turn a prompt into a Response.
+// Gemini, Groq, and OpenAI-compatible endpoints (LocalAI, Ollama, ...) all
+// satisfy this so processQuestion can fan a question out to any mix of them.
+type Provider interface {
+	Name() string
+	Generate(ctx context.Context, prompt string) (*Response, error)
+	Close() error
+}
+
+// GeminiProvider talks to the Gemini API via the official client.
+type GeminiProvider struct {
+	name   string
+	weight float64
+	model  string
+	client *genai.Client
+}
+
+func NewGeminiProvider(ctx context.Context, name, apiKey, model string, weight float64) (*GeminiProvider, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+	if model == "" {
+		model = "gemini-pro"
+	}
+	return &GeminiProvider{name: name, weight: weight, model: model, client: client}, nil
+}
+
+func (p *GeminiProvider) Name() string    { return p.name }
+func (p *GeminiProvider) Weight() float64 { return p.weight }
+
+func (p *GeminiProvider) Generate(ctx context.Context, prompt string) (*Response, error) {
+	model := p.client.GenerativeModel(p.model)
+	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s response: %v", p.name, err)
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("%s returned no candidates", p.name)
+	}
+	return &Response{
+		Source:  p.name,
+		Content: string(resp.Candidates[0].Content.Parts[0].(genai.Text)),
+	}, nil
+}
+
+func (p *GeminiProvider) Close() error {
+	return p.client.Close()
+}
+
+// GroqProvider talks to Groq's OpenAI-compatible chat completions endpoint.
+type GroqProvider struct {
+	name    string
+	weight  float64
+	model   string
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewGroqProvider(name, apiKey, model string, weight float64) *GroqProvider {
+	if model == "" {
+		model = "llama-3.3-70b-versatile"
+	}
+	return &GroqProvider{
+		name:    name,
+		weight:  weight,
+		model:   model,
+		apiKey:  apiKey,
+		baseURL: "https://api.groq.com/openai/v1/chat/completions",
+		client:  &http.Client{},
+	}
+}
+
+func (p *GroqProvider) Name() string    { return p.name }
+func (p *GroqProvider) Weight() float64 { return p.weight }
+
+func (p *GroqProvider) Generate(ctx context.Context, prompt string) (*Response, error) {
+	return p.generateMessages(ctx, []Message{{Role: "user", Content: prompt}})
+}
+
+// generateMessages sends a pre-built message list to Groq's chat completions
+// endpoint, shared by Generate and the history-aware GenerateWithHistory.
+func (p *GroqProvider) generateMessages(ctx context.Context, messages []Message) (*Response, error) {
+	reqBody := GroqRequest{
+		Model:    p.model,
+		Messages: messages,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+	}
+
+	var groqResp GroqResponse
+	if err := json.NewDecoder(resp.Body).Decode(&groqResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if len(groqResp.Choices) == 0 {
+		return nil, fmt.Errorf("no response choices returned")
+	}
+
+	return &Response{
+		Source:  p.name,
+		Content: groqResp.Choices[0].Message.Content,
+	}, nil
+}
+
+func (p *GroqProvider) Close() error { return nil }
+
+// OpenAICompatProvider targets any server implementing the OpenAI chat
+// completions wire format, such as LocalAI or Ollama's compatibility layer.
+type OpenAICompatProvider struct {
+	name    string
+	weight  float64
+	model   string
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewOpenAICompatProvider(name, baseURL, apiKey, model string, weight float64) *OpenAICompatProvider {
+	return &OpenAICompatProvider{
+		name:    name,
+		weight:  weight,
+		model:   model,
+		apiKey:  apiKey,
+		baseURL: strings.TrimRight(baseURL, "/") + "/chat/completions",
+		client:  &http.Client{},
+	}
+}
+
+func (p *OpenAICompatProvider) Name() string    { return p.name }
+func (p *OpenAICompatProvider) Weight() float64 { return p.weight }
+
+func (p *OpenAICompatProvider) Generate(ctx context.Context, prompt string) (*Response, error) {
+	reqBody := GroqRequest{
+		Model: p.model,
+		Messages: []Message{
+			{Role: "user", Content: prompt},
+		},
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+	}
+
+	var compatResp GroqResponse
+	if err := json.NewDecoder(resp.Body).Decode(&compatResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if len(compatResp.Choices) == 0 {
+		return nil, fmt.Errorf("no response choices returned")
+	}
+
+	return &Response{
+		Source:  p.name,
+		Content: compatResp.Choices[0].Message.Content,
+	}, nil
+}
+
+func (p *OpenAICompatProvider) Close() error { return nil }
+
+// weighted pairs a provider's Weight() with its interface value so the
+// ensemble package doesn't need a type switch to read it back out.
+type weighted interface {
+	Weight() float64
+}
+
+func providerWeight(p Provider) float64 {
+	if w, ok := p.(weighted); ok {
+		return w.Weight()
+	}
+	return 1.0
+}
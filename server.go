@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// consensusModelID is the virtual model name the `serve` gateway reports, so
+// any OpenAI SDK can point base_url at this server and ask for it by name.
+const consensusModelID = "answers-only-consensus"
+
+// ChatCompletionRequest is the subset of the OpenAI chat completions request
+// body this gateway understands.
+type ChatCompletionRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream,omitempty"`
+}
+
+type chatCompletionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatHistoryFromMessages converts the leading turns of an OpenAI-shaped
+// message list (everything but the final, just-asked question) into
+// provider-agnostic ChatTurns, dropping any role ChatTurn doesn't model
+// (e.g. "system").
+func chatHistoryFromMessages(messages []Message) []ChatTurn {
+	history := make([]ChatTurn, 0, len(messages))
+	for _, m := range messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			continue
+		}
+		history = append(history, ChatTurn{Role: m.Role, Content: m.Content})
+	}
+	return history
+}
+
+type chatCompletionChoice struct {
+	Index        int                   `json:"index"`
+	Message      chatCompletionMessage `json:"message"`
+	FinishReason string                `json:"finish_reason"`
+}
+
+// ChatCompletionResponse is an OpenAI-shaped non-streaming response.
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []chatCompletionChoice `json:"choices"`
+}
+
+type chatCompletionChunkChoice struct {
+	Index        int                   `json:"index"`
+	Delta        chatCompletionMessage `json:"delta"`
+	FinishReason *string               `json:"finish_reason"`
+}
+
+// ChatCompletionChunk is one SSE event of a streaming response.
+type ChatCompletionChunk struct {
+	ID      string                      `json:"id"`
+	Object  string                      `json:"object"`
+	Created int64                       `json:"created"`
+	Model   string                      `json:"model"`
+	Choices []chatCompletionChunkChoice `json:"choices"`
+}
+
+// runServe parses the `serve` subcommand's flags, builds the shared runtime,
+// and starts the OpenAI-compatible gateway.
+func runServe(ctx context.Context, geminiKey, groqKey string, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	ensemblePath := fs.String("ensemble-config", "ensemble.yaml", "Path to the ensemble providers config")
+	maxRetries := fs.Int("max-retries", 3, "Maximum number of retry attempts per question")
+	similarityThreshold := fs.Float64("similarity-threshold", 0.85, "Cosine similarity above which two responses are considered equivalent")
+	ambiguousThreshold := fs.Float64("ambiguous-threshold", 0.70, "Cosine similarity below which two responses are considered different; between this and similarity-threshold, an LLM judge decides")
+	embeddingCachePath := fs.String("embedding-cache", "embedding-cache.json", "Path to the on-disk embedding cache")
+	fs.Parse(args)
+
+	rt, cleanup, err := setupRuntime(ctx, geminiKey, groqKey, *ensemblePath, *maxRetries, *similarityThreshold, *ambiguousThreshold, *embeddingCachePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", handleChatCompletions(rt))
+	mux.HandleFunc("/v1/models", handleModels)
+	mux.HandleFunc("/healthz", handleHealthz)
+
+	log.Printf("answers-only gateway listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "ok")
+}
+
+func handleModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"object": "list",
+		"data": []map[string]any{
+			{"id": consensusModelID, "object": "model", "owned_by": "answers-only"},
+		},
+	})
+}
+
+// handleChatCompletions routes an OpenAI-shaped request through the ensemble
+// pipeline and replies in the OpenAI wire format, streaming the answer as
+// synthetic SSE deltas when the caller asked for stream=true.
+func handleChatCompletions(rt *runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(req.Messages) == 0 {
+			http.Error(w, "messages must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		question := req.Messages[len(req.Messages)-1].Content
+
+		// Replay every prior turn the client sent as chat history, so a
+		// multi-turn client (LangChain, a chat UI, ...) doesn't lose context
+		// just because this gateway is stateless between requests.
+		session := &ChatSession{History: chatHistoryFromMessages(req.Messages[:len(req.Messages)-1])}
+
+		// maxAttachments is 0: the gateway takes arbitrary client messages, and
+		// `@` is common in ordinary text (email addresses, handles), so there's
+		// no safe way to tell an intentional @file token from one; attachment
+		// parsing is disabled entirely rather than guessing.
+		answer, err := processQuestion(r.Context(), question, rt.config, rt.providers, rt.ensembleCfg, false, session, rt.comparator, 0)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to generate response: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+		if req.Stream {
+			writeStreamingChatCompletion(w, id, answer)
+			return
+		}
+		writeChatCompletion(w, id, answer)
+	}
+}
+
+func writeChatCompletion(w http.ResponseWriter, id, answer string) {
+	resp := ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   consensusModelID,
+		Choices: []chatCompletionChoice{
+			{
+				Index:        0,
+				Message:      chatCompletionMessage{Role: "assistant", Content: answer},
+				FinishReason: "stop",
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeStreamingChatCompletion fakes a token stream over an answer the
+// ensemble already settled on: the underlying pipeline has to agree on a
+// final answer before it can be voted on, so there's nothing to stream
+// token-by-token from the providers themselves, but clients expecting
+// stream=true still get incremental deltas instead of one giant chunk.
+func writeStreamingChatCompletion(w http.ResponseWriter, id, answer string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeChatCompletion(w, id, answer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	created := time.Now().Unix()
+	words := strings.SplitAfter(answer, " ")
+
+	for _, word := range words {
+		chunk := ChatCompletionChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   consensusModelID,
+			Choices: []chatCompletionChunkChoice{
+				{Index: 0, Delta: chatCompletionMessage{Content: word}},
+			},
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	stopReason := "stop"
+	final := ChatCompletionChunk{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   consensusModelID,
+		Choices: []chatCompletionChunkChoice{
+			{Index: 0, Delta: chatCompletionMessage{}, FinishReason: &stopReason},
+		},
+	}
+	data, _ := json.Marshal(final)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
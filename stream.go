@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+// StreamingProvider is implemented by providers that can emit tokens as they
+// arrive instead of waiting for the full response. onToken is called once
+// per chunk of text; the final accumulated Response is still returned so
+// callers that don't care about streaming (e.g. the ensemble vote) can treat
+// it exactly like a normal Generate result.
+type StreamingProvider interface {
+	Provider
+	GenerateStream(ctx context.Context, prompt string, onToken func(string)) (*Response, error)
+}
+
+// StreamingChatProvider is implemented by providers that can stream tokens
+// while still carrying conversation history natively, so a live chat session
+// doesn't have to give up --stream once it has turns to replay.
+type StreamingChatProvider interface {
+	ChatProvider
+	GenerateStreamWithHistory(ctx context.Context, history []ChatTurn, prompt string, onToken func(string)) (*Response, error)
+}
+
+// GenerateStream pulls tokens from Gemini's streaming API, printing each
+// chunk via onToken as it arrives and returning the fully assembled Response.
+func (p *GeminiProvider) GenerateStream(ctx context.Context, prompt string, onToken func(string)) (*Response, error) {
+	model := p.client.GenerativeModel(p.model)
+	iter := model.GenerateContentStream(ctx, genai.Text(prompt))
+	return drainGeminiStream(iter, p.name, onToken)
+}
+
+// GenerateStreamWithHistory streams a response the same way GenerateStream
+// does, but seeded with history via StartChat, so a live chat session can
+// keep --stream once it has turns to replay.
+func (p *GeminiProvider) GenerateStreamWithHistory(ctx context.Context, history []ChatTurn, prompt string, onToken func(string)) (*Response, error) {
+	model := p.client.GenerativeModel(p.model)
+	cs := model.StartChat()
+	cs.History = toGenaiHistory(history)
+	iter := cs.SendMessageStream(ctx, genai.Text(prompt))
+	return drainGeminiStream(iter, p.name, onToken)
+}
+
+// drainGeminiStream reads every chunk off iter, forwarding text parts to
+// onToken as they arrive and returning the fully assembled Response. Shared
+// by GenerateStream and GenerateStreamWithHistory, which differ only in how
+// the iterator is created.
+func drainGeminiStream(iter *genai.GenerateContentResponseIterator, name string, onToken func(string)) (*Response, error) {
+	var sb strings.Builder
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stream %s response: %v", name, err)
+		}
+
+		if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+			continue
+		}
+
+		for _, part := range resp.Candidates[0].Content.Parts {
+			text, ok := part.(genai.Text)
+			if !ok {
+				continue
+			}
+			chunk := string(text)
+			sb.WriteString(chunk)
+			onToken(chunk)
+		}
+	}
+
+	return &Response{Source: name, Content: sb.String()}, nil
+}
+
+// GenerateStream requests a server-sent-events stream from Groq and parses
+// each event as it arrives: events are separated by a blank line, each data
+// line is prefixed with "data: ", and the stream ends with a literal
+// "data: [DONE]" event.
+func (p *GroqProvider) GenerateStream(ctx context.Context, prompt string, onToken func(string)) (*Response, error) {
+	return p.generateMessagesStream(ctx, []Message{{Role: "user", Content: prompt}}, onToken)
+}
+
+// GenerateStreamWithHistory streams a response the same way GenerateStream
+// does, but with history prepended to the message list, so a live chat
+// session can keep --stream once it has turns to replay.
+func (p *GroqProvider) GenerateStreamWithHistory(ctx context.Context, history []ChatTurn, prompt string, onToken func(string)) (*Response, error) {
+	messages := append(historyToMessages(history), Message{Role: "user", Content: prompt})
+	return p.generateMessagesStream(ctx, messages, onToken)
+}
+
+// generateMessagesStream streams a pre-built message list from Groq's chat
+// completions endpoint, shared by GenerateStream and
+// GenerateStreamWithHistory.
+func (p *GroqProvider) generateMessagesStream(ctx context.Context, messages []Message, onToken func(string)) (*Response, error) {
+	reqBody := GroqRequest{
+		Model:    p.model,
+		Messages: messages,
+		Stream:   true,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+	}
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(splitSSEEvents)
+
+	for scanner.Scan() {
+		event := scanner.Text()
+		for _, line := range strings.Split(event, "\n") {
+			line = strings.TrimSpace(line)
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+
+			var chunk groqStreamChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return nil, fmt.Errorf("failed to decode stream event: %v", err)
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+
+			content := chunk.Choices[0].Delta.Content
+			if content == "" {
+				continue
+			}
+			sb.WriteString(content)
+			onToken(content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %v", err)
+	}
+
+	return &Response{Source: p.name, Content: sb.String()}, nil
+}
+
+// groqStreamChunk is one SSE event from Groq's streaming chat completions.
+type groqStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// splitSSEEvents is a bufio.SplitFunc that splits an SSE byte stream on
+// blank-line-delimited ("\n\n") event boundaries.
+func splitSSEEvents(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := strings.Index(string(data), "\n\n"); i >= 0 {
+		return i + 2, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// primaryStreamingIndex returns the index of the first provider that supports
+// live streaming, or -1 if none do. Only that one provider's tokens are
+// printed live: racing every streaming-capable provider's tokens to the same
+// stdout interleaves them into unreadable output, so the rest answer
+// silently in the background and only surface once they're done.
+func primaryStreamingIndex(providers []Provider) int {
+	for i, p := range providers {
+		if _, ok := p.(StreamingProvider); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// fanOutStream is fanOut's streaming counterpart: the primary streaming
+// provider's tokens are printed live as they arrive, and every other
+// provider (streaming-capable or not) answers concurrently in the
+// background via a plain Generate.
+func fanOutStream(ctx context.Context, providers []Provider, prompt string) []providerResult {
+	primary := primaryStreamingIndex(providers)
+
+	results := make([]providerResult, len(providers))
+	done := make(chan struct{}, len(providers))
+
+	for i, p := range providers {
+		go func(i int, p Provider) {
+			defer func() { done <- struct{}{} }()
+
+			if i == primary {
+				sp := p.(StreamingProvider)
+				resp, err := sp.GenerateStream(ctx, prompt, func(token string) {
+					fmt.Printf("[%s] %s", p.Name(), token)
+				})
+				results[i] = providerResult{provider: p, response: resp, err: err}
+				return
+			}
+
+			resp, err := p.Generate(ctx, prompt)
+			results[i] = providerResult{provider: p, response: resp, err: err}
+		}(i, p)
+	}
+
+	for range providers {
+		<-done
+	}
+	return results
+}
+
+// primaryStreamingChatIndex is primaryStreamingIndex's history-aware
+// counterpart, picking the first provider that can stream tokens while
+// still carrying history natively.
+func primaryStreamingChatIndex(providers []Provider) int {
+	for i, p := range providers {
+		if _, ok := p.(StreamingChatProvider); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// fanOutChatStream is fanOutChat's streaming counterpart: the primary
+// streaming-chat provider's tokens are printed live as they arrive, with
+// history carried natively; every other provider answers concurrently in the
+// background via GenerateWithHistory (or a bare Generate, for providers that
+// don't carry history at all) for the same racing-to-stdout reason
+// fanOutStream limits itself to one live provider. The history is copied up
+// front for the same reason fanOutChat copies it.
+func fanOutChatStream(ctx context.Context, providers []Provider, session *ChatSession, prompt string) []providerResult {
+	history := make([]ChatTurn, len(session.History))
+	copy(history, session.History)
+
+	primary := primaryStreamingChatIndex(providers)
+
+	results := make([]providerResult, len(providers))
+	done := make(chan struct{}, len(providers))
+
+	for i, p := range providers {
+		go func(i int, p Provider) {
+			defer func() { done <- struct{}{} }()
+
+			if i == primary {
+				scp := p.(StreamingChatProvider)
+				resp, err := scp.GenerateStreamWithHistory(ctx, history, prompt, func(token string) {
+					fmt.Printf("[%s] %s", p.Name(), token)
+				})
+				results[i] = providerResult{provider: p, response: resp, err: err}
+				return
+			}
+
+			if cp, ok := p.(ChatProvider); ok {
+				resp, err := cp.GenerateWithHistory(ctx, history, prompt)
+				results[i] = providerResult{provider: p, response: resp, err: err}
+				return
+			}
+
+			resp, err := p.Generate(ctx, prompt)
+			results[i] = providerResult{provider: p, response: resp, err: err}
+		}(i, p)
+	}
+
+	for range providers {
+		<-done
+	}
+	return results
+}